@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Cache is an on-disk HTTP response cache keyed by request URL. It lets
+// repeated runs against the same book issue conditional GETs and reuse
+// the cached body on a 304, which makes iterating on the converter much
+// cheaper and is friendlier to the upstream server.
+type Cache struct {
+	dir     string
+	refresh bool
+}
+
+// cacheMeta is the small JSON sidecar stored next to each cached body.
+type cacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func NewCache(dir string, refresh bool) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, refresh: refresh}, nil
+}
+
+// DefaultCacheDir returns "~/.cache/projekt-gutenberg-dl" (or the
+// platform equivalent).
+func DefaultCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "projekt-gutenberg-dl"), nil
+}
+
+func (c *Cache) paths(url string) (body, meta string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key+".html"), filepath.Join(c.dir, key+".json")
+}
+
+// Get performs a GET against url using client, transparently attaching
+// conditional request headers when a cached copy exists and serving the
+// cached body on a 304. Unless -refresh was passed, a cached copy is
+// consulted whenever present; it is also served if the request itself
+// fails. A 200 response replaces the cached copy.
+func (c *Cache) Get(client *http.Client, url string) (body []byte, statusCode int, err error) {
+	bodyPath, metaPath := c.paths(url)
+
+	var meta cacheMeta
+	haveCached := false
+	if !c.refresh {
+		if b, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(b, &meta) == nil {
+			if _, err := os.Stat(bodyPath); err == nil {
+				haveCached = true
+			}
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if haveCached {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if haveCached {
+			body, err = os.ReadFile(bodyPath)
+			return body, http.StatusOK, err
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && haveCached {
+		body, err = os.ReadFile(bodyPath)
+		return body, http.StatusOK, err
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := os.WriteFile(bodyPath, body, 0644); err == nil {
+			newMeta := cacheMeta{
+				ETag:         resp.Header.Get("ETag"),
+				LastModified: resp.Header.Get("Last-Modified"),
+			}
+			if b, err := json.Marshal(newMeta); err == nil {
+				os.WriteFile(metaPath, b, 0644)
+			}
+		}
+	}
+	return body, resp.StatusCode, nil
+}
+
+// get fetches url with client, transparently going through e.Cache when
+// one is configured.
+func (e *Extractor) get(client *http.Client, url string) (body []byte, statusCode int, err error) {
+	if e.Cache != nil {
+		return e.Cache.Get(client, url)
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	return body, resp.StatusCode, err
+}
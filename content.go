@@ -0,0 +1,366 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// spanStyle tracks the inline styling inherited from ancestor elements
+// while walking down the HTML tree.
+type spanStyle struct {
+	italic bool
+	code   bool
+	spaced bool
+}
+
+// hasClass reports whether n has the given HTML class.
+func hasClass(n *html.Node, class string) bool {
+	for _, a := range n.Attr {
+		if a.Key == "class" {
+			for _, cl := range strings.Fields(a.Val) {
+				if cl == class {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// attr returns the value of the given attribute, or "" if n doesn't have it.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// collapseSpaces replaces every run of spaces with a single space and
+// strips newlines, the way browsers collapse HTML whitespace.
+func collapseSpaces(s string) string {
+	s = strings.ReplaceAll(s, "\n", "")
+	var sb strings.Builder
+	var prevWasSpace bool
+	for _, c := range s {
+		if c == ' ' {
+			if prevWasSpace {
+				continue
+			}
+			prevWasSpace = true
+		} else {
+			prevWasSpace = false
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// spaceOutRunes inserts a space between every rune, emulating the
+// letter-spacing ("gesperrt") effect old German typography uses for
+// emphasis, which the site marks up via the "spaced" CSS class.
+func spaceOutRunes(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		sb.WriteRune(r)
+		if i < len(runes)-1 {
+			sb.WriteRune(' ')
+		}
+	}
+	return sb.String()
+}
+
+// headingLevel returns the heading level (1-6) for an h1..h6 data atom.
+// atom values are hash-table offsets, not sequential, so the level can't
+// be derived by subtracting atom.H1 -- it has to be looked up explicitly.
+func headingLevel(a atom.Atom) int {
+	switch a {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	default:
+		return 1
+	}
+}
+
+// resolveURL resolves ref, which may be relative, against baseURL.
+func resolveURL(baseURL, ref string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(r).String(), nil
+}
+
+// isFootnoteID reports whether id looks like a footnote anchor, e.g.
+// "fn1" or "fn23".
+func isFootnoteID(id string) bool {
+	id = strings.TrimPrefix(id, "#")
+	if !strings.HasPrefix(id, "fn") || len(id) == len("fn") {
+		return false
+	}
+	for _, c := range id[len("fn"):] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineSpans converts n and its descendants into styled text runs.
+func inlineSpans(n *html.Node, style spanStyle) []Span {
+	switch n.Type {
+	case html.TextNode:
+		text := collapseSpaces(n.Data)
+		if text == "" {
+			return nil
+		}
+		if style.spaced {
+			text = spaceOutRunes(text)
+		}
+		return []Span{{Text: text, Italic: style.italic, Code: style.code}}
+	case html.ElementNode:
+		childStyle := style
+		if hasClass(n, "spaced") {
+			childStyle.spaced = true
+		}
+		switch n.DataAtom {
+		case atom.Br:
+			return []Span{{Text: "\n\n"}}
+		case atom.Tt:
+			childStyle.code = true
+		case atom.I:
+			childStyle.italic = true
+		case atom.A:
+			if href := attr(n, "href"); isFootnoteID(href) {
+				id := strings.TrimPrefix(strings.TrimPrefix(href, "#"), "fn")
+				return []Span{{Text: strings.TrimSpace(textContent(n)), FootnoteRef: id}}
+			}
+		case atom.Span, atom.Div, atom.Sup:
+			// Transparent inline containers.
+		default:
+			clearLine()
+			printWarn("Unknown inline atom: %v", n.Data)
+		}
+		return childSpans(n, childStyle)
+	default:
+		clearLine()
+		printWarn("Unknown type: %v", n.Type)
+		return nil
+	}
+}
+
+// textContent returns the concatenated, unstyled text of n and its
+// descendants.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+// childSpans converts all children of n into styled text runs.
+func childSpans(n *html.Node, style spanStyle) []Span {
+	var spans []Span
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		spans = append(spans, inlineSpans(c, style)...)
+	}
+	return spans
+}
+
+// ListItem is one <li> of a List, which may itself contain nested lists.
+type ListItem struct {
+	Spans    []Span
+	Children []List
+}
+
+// List is a (possibly nested) <ul>/<ol>.
+type List struct {
+	Ordered bool
+	Items   []ListItem
+}
+
+// TableCell is one <td>/<th> of a Table.
+type TableCell struct {
+	Spans  []Span
+	Header bool
+}
+
+// Table is a <table>, flattened to its rows of cells. <thead>/<tbody>/
+// <tfoot> wrappers aren't preserved -- TableCell.Header distinguishes
+// header cells instead.
+type Table struct {
+	Rows [][]TableCell
+}
+
+// Footnote is a footnote definition collected from a block carrying an
+// id of the form "fn<N>", pulled out of the normal flow so it can be
+// rendered together at the end of the chapter.
+type Footnote struct {
+	ID    string
+	Spans []Span
+}
+
+// emitBlocks walks the given top-level nodes, feeding their block-level
+// content (headings, paragraphs, images, lists, tables) into r and
+// collecting footnote definitions along the way. If any footnotes were
+// found, they're emitted via r.EmitFootnotes once the rest of the
+// content is done. baseURL is the chapter page's own URL, used to
+// resolve any relative image src against.
+func emitBlocks(nodes []*html.Node, r Renderer, baseURL string) error {
+	var footnotes []Footnote
+	for _, n := range nodes {
+		if err := emitBlock(n, r, &footnotes, baseURL); err != nil {
+			return err
+		}
+	}
+	if len(footnotes) == 0 {
+		return nil
+	}
+	return r.EmitFootnotes(footnotes)
+}
+
+func emitBlock(n *html.Node, r Renderer, footnotes *[]Footnote, baseURL string) error {
+	if n.Type == html.TextNode {
+		if spans := inlineSpans(n, spanStyle{}); len(spans) > 0 {
+			return r.EmitParagraph(spans)
+		}
+		return nil
+	}
+	if n.Type != html.ElementNode {
+		clearLine()
+		printWarn("Unknown type: %v", n.Type)
+		return nil
+	}
+	if id := attr(n, "id"); isFootnoteID(id) {
+		*footnotes = append(*footnotes, Footnote{
+			ID:    strings.TrimPrefix(id, "fn"),
+			Spans: childSpans(n, spanStyle{}),
+		})
+		return nil
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return r.EmitHeading(headingLevel(n.DataAtom), childSpans(n, spanStyle{}))
+	case atom.P:
+		if hasClass(n, "centerbig") {
+			return r.EmitHeading(4, childSpans(n, spanStyle{}))
+		}
+		return r.EmitParagraph(childSpans(n, spanStyle{}))
+	case atom.Div:
+		for _, c := range childNodes(n) {
+			if err := emitBlock(c, r, footnotes, baseURL); err != nil {
+				return err
+			}
+		}
+		return nil
+	case atom.Img:
+		src, err := resolveURL(baseURL, attr(n, "src"))
+		if err != nil {
+			clearLine()
+			printWarn("Could not resolve image src %q: %v", attr(n, "src"), err)
+			return nil
+		}
+		return r.EmitImage(src, attr(n, "alt"))
+	case atom.Ul, atom.Ol:
+		return r.EmitList(buildList(n))
+	case atom.Table:
+		return r.EmitTable(buildTable(n))
+	case atom.Br:
+		return nil
+	default:
+		clearLine()
+		printWarn("Unknown data atom: %v", n.Data)
+		return nil
+	}
+}
+
+// buildList converts a <ul>/<ol> node into a List.
+func buildList(n *html.Node) List {
+	list := List{Ordered: n.DataAtom == atom.Ol}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Li {
+			list.Items = append(list.Items, buildListItem(c))
+		}
+	}
+	return list
+}
+
+// buildListItem converts a <li> node into a ListItem, pulling any
+// directly nested <ul>/<ol> out as Children rather than inline spans.
+func buildListItem(n *html.Node) ListItem {
+	var item ListItem
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.DataAtom == atom.Ul || c.DataAtom == atom.Ol) {
+			item.Children = append(item.Children, buildList(c))
+			continue
+		}
+		item.Spans = append(item.Spans, inlineSpans(c, spanStyle{})...)
+	}
+	return item
+}
+
+// buildTable converts a <table> node into a Table, flattening away any
+// <thead>/<tbody>/<tfoot> wrappers.
+func buildTable(n *html.Node) Table {
+	var t Table
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			case atom.Tr:
+				var row []TableCell
+				for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+					if cc.Type != html.ElementNode {
+						continue
+					}
+					if cc.DataAtom == atom.Td || cc.DataAtom == atom.Th {
+						row = append(row, TableCell{
+							Spans:  childSpans(cc, spanStyle{}),
+							Header: cc.DataAtom == atom.Th,
+						})
+					}
+				}
+				t.Rows = append(t.Rows, row)
+			}
+		}
+	}
+	walk(n)
+	return t
+}
+
+func childNodes(n *html.Node) []*html.Node {
+	var out []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gq "github.com/PuerkitoBio/goquery"
+)
+
+const (
+	defaultJobs    = 4
+	chapterTimeout = 30 * time.Second
+	maxRetries     = 4
+	retryBaseDelay = 500 * time.Millisecond
+)
+
+var httpClient = &http.Client{Timeout: chapterTimeout}
+
+// chapterResult holds the outcome of fetching a single chapter.
+type chapterResult struct {
+	doc *gq.Document
+	err error
+}
+
+// DownloadChapters fetches all of e.Chapters concurrently using up to
+// jobs workers, retrying transient failures with exponential backoff.
+// Results are returned in the same order as e.Chapters, regardless of
+// the order the downloads actually complete in. progress, if non-nil, is
+// called exactly once per finished download and may be invoked from
+// multiple goroutines concurrently.
+func (e *Extractor) DownloadChapters(jobs int, progress func(done, total int)) ([]*gq.Document, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	total := len(e.Chapters)
+	results := make([]chapterResult, total)
+
+	var nextIdx int32 = -1
+	var doneCount int32
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < total; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt32(&nextIdx, 1))
+				if i >= total {
+					return
+				}
+				doc, err := e.fetchChapterDoc(e.Chapters[i].URL)
+				results[i] = chapterResult{doc: doc, err: err}
+				if progress != nil {
+					progress(int(atomic.AddInt32(&doneCount, 1)), total)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	docs := make([]*gq.Document, total)
+	for i, r := range results {
+		if r.err != nil {
+			return nil, fmt.Errorf("chapter %d: %w", i+1, r.err)
+		}
+		docs[i] = r.doc
+	}
+	return docs, nil
+}
+
+// fetchChapterDoc fetches and parses a single chapter, retrying on
+// network errors and 5xx responses with exponential backoff plus jitter.
+func (e *Extractor) fetchChapterDoc(url string) (*gq.Document, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryDelay(attempt))
+		}
+		body, status, err := e.get(httpClient, url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if status >= 500 {
+			lastErr = fmt.Errorf("server returned status %d", status)
+			continue
+		}
+		doc, err := gq.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+	return nil, lastErr
+}
+
+// retryDelay returns the exponential backoff (with jitter) to wait
+// before the given retry attempt (1-based).
+func retryDelay(attempt int) time.Duration {
+	backoff := retryBaseDelay * time.Duration(math.Pow(2, float64(attempt-1)))
+	jitter := time.Duration(rand.Int63n(int64(backoff)))
+	return backoff + jitter
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// EPUBRenderer renders a book as a single EPUB3 file: one XHTML document
+// per chapter, an EPUB3 nav document plus an EPUB2 toc.ncx for reader
+// compatibility, and images embedded as they're encountered. The first
+// embedded image (normally found on the title page) is marked as the
+// cover image.
+type EPUBRenderer struct {
+	zw   *zip.Writer
+	meta MetaInfo
+
+	chapters  []epubChapter
+	images    []epubImage
+	imageURLs map[string]string // source URL -> image path inside the EPUB
+	coverID   string
+
+	curChapter *strings.Builder
+	curTitle   string
+}
+
+type epubChapter struct {
+	id, title, file string
+}
+
+type epubImage struct {
+	id, file string
+}
+
+func NewEPUBRenderer(w io.Writer) *EPUBRenderer {
+	return &EPUBRenderer{
+		zw:        zip.NewWriter(w),
+		imageURLs: make(map[string]string),
+	}
+}
+
+func (e *EPUBRenderer) BeginBook(meta MetaInfo) error {
+	e.meta = meta
+	// The mimetype file must be the first entry and must be stored
+	// uncompressed for the EPUB to be considered valid.
+	fw, err := e.zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, "application/epub+zip"); err != nil {
+		return err
+	}
+	cw, err := e.zw.Create("META-INF/container.xml")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(cw, `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`)
+	return err
+}
+
+func (e *EPUBRenderer) BeginChapter(title string) error {
+	e.curTitle = title
+	e.curChapter = &strings.Builder{}
+	fmt.Fprintf(e.curChapter, "<h1>%s</h1>\n", xmlEscape(title))
+	return nil
+}
+
+func (e *EPUBRenderer) EmitHeading(level int, spans []Span) error {
+	// The chapter title is already rendered as <h1>, so every content
+	// heading is bumped one level down; clamp so a source <h6> doesn't
+	// overflow past the highest valid XHTML heading tag.
+	tag := level + 1
+	if tag > 6 {
+		tag = 6
+	}
+	fmt.Fprintf(e.curChapter, "<h%d>%s</h%d>\n", tag, spansToXHTML(spans), tag)
+	return nil
+}
+
+func (e *EPUBRenderer) EmitParagraph(spans []Span) error {
+	fmt.Fprintf(e.curChapter, "<p>%s</p>\n", spansToXHTML(spans))
+	return nil
+}
+
+func (e *EPUBRenderer) EmitImage(src, alt string) error {
+	file, err := e.embedImage(src)
+	if err != nil {
+		clearLine()
+		printWarn("Could not embed image %v: %v", src, err)
+		return nil
+	}
+	fmt.Fprintf(e.curChapter, `<img src="%s" alt="%s"/>`+"\n", file, xmlEscape(alt))
+	return nil
+}
+
+func (e *EPUBRenderer) EmitList(list List) error {
+	e.curChapter.WriteString(renderListXHTML(list))
+	return nil
+}
+
+func renderListXHTML(list List) string {
+	tag := "ul"
+	if list.Ordered {
+		tag = "ol"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<%s>\n", tag)
+	for _, item := range list.Items {
+		fmt.Fprintf(&sb, "<li>%s", spansToXHTML(item.Spans))
+		for _, child := range item.Children {
+			sb.WriteString(renderListXHTML(child))
+		}
+		sb.WriteString("</li>\n")
+	}
+	fmt.Fprintf(&sb, "</%s>\n", tag)
+	return sb.String()
+}
+
+func (e *EPUBRenderer) EmitTable(table Table) error {
+	e.curChapter.WriteString("<table>\n")
+	for _, row := range table.Rows {
+		e.curChapter.WriteString("<tr>")
+		for _, cell := range row {
+			tag := "td"
+			if cell.Header {
+				tag = "th"
+			}
+			fmt.Fprintf(e.curChapter, "<%s>%s</%s>", tag, spansToXHTML(cell.Spans), tag)
+		}
+		e.curChapter.WriteString("</tr>\n")
+	}
+	e.curChapter.WriteString("</table>\n")
+	return nil
+}
+
+func (e *EPUBRenderer) EmitFootnotes(footnotes []Footnote) error {
+	e.curChapter.WriteString(`<section epub:type="footnotes">` + "\n<ol>\n")
+	for _, fn := range footnotes {
+		fmt.Fprintf(e.curChapter, `<li id="fn%s">%s</li>`+"\n", xmlEscape(fn.ID), spansToXHTML(fn.Spans))
+	}
+	e.curChapter.WriteString("</ol>\n</section>\n")
+	return nil
+}
+
+// embedImage fetches src (unless already embedded) and stores it under
+// OEBPS/images, returning its path relative to OEBPS.
+func (e *EPUBRenderer) embedImage(src string) (string, error) {
+	if file, ok := e.imageURLs[src]; ok {
+		return file, nil
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	name := fmt.Sprintf("image%03d%s", len(e.images)+1, path.Ext(src))
+	fw, err := e.zw.Create("OEBPS/images/" + name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(fw, resp.Body); err != nil {
+		return "", err
+	}
+	file := "images/" + name
+	id := fmt.Sprintf("img%03d", len(e.images)+1)
+	if len(e.images) == 0 {
+		e.coverID = id
+	}
+	e.images = append(e.images, epubImage{id: id, file: file})
+	e.imageURLs[src] = file
+	return file, nil
+}
+
+func (e *EPUBRenderer) EndChapter() error {
+	n := len(e.chapters) + 1
+	file := fmt.Sprintf("chapter%03d.xhtml", n)
+	id := fmt.Sprintf("chap%03d", n)
+	w, err := e.zw.Create("OEBPS/" + file)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%s</title></head>
+<body>
+%s</body>
+</html>
+`, xmlEscape(e.curTitle), e.curChapter.String())
+	if err != nil {
+		return err
+	}
+	e.chapters = append(e.chapters, epubChapter{id: id, title: e.curTitle, file: file})
+	e.curChapter = nil
+	return nil
+}
+
+func (e *EPUBRenderer) End() error {
+	if err := e.writeNav(); err != nil {
+		return err
+	}
+	if err := e.writeToc(); err != nil {
+		return err
+	}
+	if err := e.writeOPF(); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
+
+func (e *EPUBRenderer) writeNav() error {
+	w, err := e.zw.Create("OEBPS/nav.xhtml")
+	if err != nil {
+		return err
+	}
+	var items strings.Builder
+	for _, c := range e.chapters {
+		fmt.Fprintf(&items, `      <li><a href="%s">%s</a></li>`+"\n", c.file, xmlEscape(c.title))
+	}
+	_, err = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>Table of Contents</title></head>
+<body>
+  <nav epub:type="toc">
+    <ol>
+%s    </ol>
+  </nav>
+</body>
+</html>
+`, items.String())
+	return err
+}
+
+func (e *EPUBRenderer) writeToc() error {
+	w, err := e.zw.Create("OEBPS/toc.ncx")
+	if err != nil {
+		return err
+	}
+	var points strings.Builder
+	for i, c := range e.chapters {
+		fmt.Fprintf(&points, `    <navPoint id="%s" playOrder="%d">
+      <navLabel><text>%s</text></navLabel>
+      <content src="%s"/>
+    </navPoint>
+`, c.id, i+1, xmlEscape(c.title), c.file)
+	}
+	_, err = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="%s"/>
+  </head>
+  <docTitle><text>%s</text></docTitle>
+  <navMap>
+%s  </navMap>
+</ncx>
+`, xmlEscape(e.meta.ToTitle()), xmlEscape(e.meta.Title), points.String())
+	return err
+}
+
+func (e *EPUBRenderer) writeOPF() error {
+	w, err := e.zw.Create("OEBPS/content.opf")
+	if err != nil {
+		return err
+	}
+	var manifest, spine strings.Builder
+	for _, c := range e.chapters {
+		fmt.Fprintf(&manifest, `    <item id="%s" href="%s" media-type="application/xhtml+xml"/>`+"\n", c.id, c.file)
+		fmt.Fprintf(&spine, `    <itemref idref="%s"/>`+"\n", c.id)
+	}
+	for _, img := range e.images {
+		props := ""
+		if img.id == e.coverID {
+			props = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&manifest, `    <item id="%s" href="%s" media-type="%s"%s/>`+"\n", img.id, img.file, mimeTypeForExt(path.Ext(img.file)), props)
+	}
+	coverMeta := ""
+	if e.coverID != "" {
+		coverMeta = fmt.Sprintf(`    <meta name="cover" content="%s"/>`+"\n", e.coverID)
+	}
+	_, err = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:creator>%s</dc:creator>
+    <dc:language>de</dc:language>
+%s  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+%s  </manifest>
+  <spine toc="ncx">
+%s  </spine>
+</package>
+`, xmlEscape(e.meta.ToTitle()), xmlEscape(e.meta.Title), xmlEscape(e.meta.Author), coverMeta, manifest.String(), spine.String())
+	return err
+}
+
+func mimeTypeForExt(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	default:
+		return "image/jpeg"
+	}
+}
+
+func xmlEscape(s string) string {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	return r.Replace(s)
+}
+
+func spansToXHTML(spans []Span) string {
+	var sb strings.Builder
+	for _, s := range spans {
+		if s.FootnoteRef != "" {
+			fmt.Fprintf(&sb, `<sup><a epub:type="noteref" href="#fn%s">%s</a></sup>`, xmlEscape(s.FootnoteRef), xmlEscape(s.Text))
+			continue
+		}
+		text := xmlEscape(s.Text)
+		switch {
+		case s.Code:
+			sb.WriteString("<code>" + text + "</code>")
+		case s.Italic:
+			sb.WriteString("<em>" + text + "</em>")
+		default:
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	gq "github.com/PuerkitoBio/goquery"
+)
+
+// GutenbergDESource handles books hosted on projekt-gutenberg.org.
+type GutenbergDESource struct{}
+
+func (GutenbergDESource) Matches(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	return u.Host == "projekt-gutenberg.org" || u.Host == "www.projekt-gutenberg.org"
+}
+
+func (GutenbergDESource) BaseURL(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if !(u.Scheme == "http" || u.Scheme == "https") {
+		return "", ErrInvalidURL
+	}
+	if !(u.Host == "projekt-gutenberg.org" || u.Host == "www.projekt-gutenberg.org") {
+		return "", ErrInvalidURL
+	}
+	spPath := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(spPath) < 2 {
+		return "", ErrInvalidURL
+	}
+	basePath := strings.Join(spPath[:2], "/")
+	return u.Scheme + "://projekt-gutenberg.org/" + basePath, nil
+}
+
+// Chapters returns the slice of links to the book's chapters, titled
+// after the full text of their index entry. The index page already lists every
+// chapter, so fetch is unused.
+func (GutenbergDESource) Chapters(baseUrl string, doc *gq.Document, fetch FetchDoc) ([]Chapter, error) {
+	chapters := make([]Chapter, 0, 8)
+	doc.Find("body ul li").Each(func(i int, s *gq.Selection) {
+		title := collapseSpaces(strings.TrimSpace(s.Text()))
+		// The website has a strange bug where the 'a' element is separate from
+		// the text element. That's why we have to search the entire 'li'
+		// element for an 'a' element with a link.
+		a := s.Find("a[href]")
+		if len(a.Nodes) == 0 {
+			// This should really never happen, that's why we're using panic.
+			panic("missing link in chapter index")
+		}
+		relUrl, _ := a.Attr("href") // We now know it must have the href attribute.
+		chapters = append(chapters, Chapter{URL: baseUrl + "/" + relUrl, Title: title})
+	})
+	if len(chapters) == 0 {
+		return nil, ErrNoChaptersFound
+	}
+	return chapters, nil
+}
+
+func (GutenbergDESource) Meta(doc *gq.Document) MetaInfo {
+	metas := doc.Find("head meta")
+	return MetaInfo{
+		Author: metas.Filter("[name=\"author\"]").AttrOr("content", "Unknown"),
+		Title:  metas.Filter("[name=\"title\"]").AttrOr("content", "Unknown"),
+		Year:   metas.Filter("[name=\"firstpub\"]").AttrOr("content", "Unknown"),
+	}
+}
+
+// ExtractContent slices out the chapter body. Every document has two
+// main <hr> elements with the given properties, marking the start and
+// end of the actual content.
+func (GutenbergDESource) ExtractContent(doc *gq.Document) (*gq.Selection, error) {
+	var passedHrs int
+	var err error
+	content := doc.Find("body").Children().FilterFunction(func(i int, s *gq.Selection) bool {
+		if s.Is("hr[size=\"1\"][color=\"#808080\"]") {
+			passedHrs++
+			return false
+		} else if s.Is("a") && (s.Text() == "<< zurück" || s.Text() == "weiter >>") {
+			// We don't want the "zurück"/"weiter"-buttons
+			return false
+		}
+		switch passedHrs {
+		case 0:
+			return false
+		case 1:
+			return true
+		case 2:
+			return false
+		default:
+			err = ErrParsingPage
+			return false
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MarkdownRenderer renders a book as a single flowing Markdown document.
+// This is the tool's original output format. Images referenced by the
+// book are downloaded into imagesDir and linked from the Markdown as
+// "images/<name>", a path relative to the Markdown file's directory.
+type MarkdownRenderer struct {
+	w         io.Writer
+	imagesDir string
+	nChapter  int
+	imageURLs map[string]string // source URL -> relative path used in the Markdown
+}
+
+func NewMarkdownRenderer(w io.Writer, imagesDir string) *MarkdownRenderer {
+	return &MarkdownRenderer{
+		w:         w,
+		imagesDir: imagesDir,
+		imageURLs: make(map[string]string),
+	}
+}
+
+func (m *MarkdownRenderer) BeginBook(meta MetaInfo) error { return nil }
+
+func (m *MarkdownRenderer) BeginChapter(title string) error {
+	m.nChapter++
+	if m.nChapter > 1 {
+		if _, err := fmt.Fprint(m.w, "\n----------------\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MarkdownRenderer) EmitHeading(level int, spans []Span) error {
+	_, err := fmt.Fprint(m.w, strings.Repeat("#", level)+" "+spansToMarkdown(spans)+"\n")
+	return err
+}
+
+func (m *MarkdownRenderer) EmitParagraph(spans []Span) error {
+	_, err := fmt.Fprint(m.w, spansToMarkdown(spans)+"\n\n")
+	return err
+}
+
+func (m *MarkdownRenderer) EmitImage(src, alt string) error {
+	relPath, err := m.downloadImage(src)
+	if err != nil {
+		clearLine()
+		printWarn("Could not download image %v: %v", src, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(m.w, "![%s](%s)\n\n", alt, relPath)
+	return err
+}
+
+// downloadImage fetches src (unless already downloaded) into m.imagesDir
+// and returns its path relative to the Markdown file.
+func (m *MarkdownRenderer) downloadImage(src string) (string, error) {
+	if relPath, ok := m.imageURLs[src]; ok {
+		return relPath, nil
+	}
+	if err := os.MkdirAll(m.imagesDir, 0755); err != nil {
+		return "", err
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	name := fmt.Sprintf("image%03d%s", len(m.imageURLs)+1, path.Ext(src))
+	f, err := os.Create(filepath.Join(m.imagesDir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return "", err
+	}
+
+	relPath := path.Join("images", name)
+	m.imageURLs[src] = relPath
+	return relPath, nil
+}
+
+func (m *MarkdownRenderer) EmitList(list List) error {
+	_, err := fmt.Fprint(m.w, renderList(list, 0))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(m.w, "\n")
+	return err
+}
+
+func renderList(list List, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	var sb strings.Builder
+	for i, item := range list.Items {
+		marker := "-"
+		if list.Ordered {
+			marker = fmt.Sprintf("%d.", i+1)
+		}
+		fmt.Fprintf(&sb, "%s%s %s\n", indent, marker, spansToMarkdown(item.Spans))
+		for _, child := range item.Children {
+			sb.WriteString(renderList(child, depth+1))
+		}
+	}
+	return sb.String()
+}
+
+func (m *MarkdownRenderer) EmitTable(table Table) error {
+	if len(table.Rows) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	for i, row := range table.Rows {
+		sb.WriteString("|")
+		for _, cell := range row {
+			fmt.Fprintf(&sb, " %s |", spansToMarkdown(cell.Spans))
+		}
+		sb.WriteString("\n")
+		if i == 0 {
+			sb.WriteString("|")
+			for range row {
+				sb.WriteString(" --- |")
+			}
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("\n")
+	_, err := fmt.Fprint(m.w, sb.String())
+	return err
+}
+
+func (m *MarkdownRenderer) EmitFootnotes(footnotes []Footnote) error {
+	if _, err := fmt.Fprint(m.w, "----\n\n"); err != nil {
+		return err
+	}
+	for _, fn := range footnotes {
+		if _, err := fmt.Fprintf(m.w, "[^%s]: %s\n", fn.ID, spansToMarkdown(fn.Spans)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(m.w, "\n")
+	return err
+}
+
+func (m *MarkdownRenderer) EndChapter() error { return nil }
+
+func (m *MarkdownRenderer) End() error { return nil }
+
+// spansToMarkdown renders a slice of styled text runs as inline Markdown.
+func spansToMarkdown(spans []Span) string {
+	var sb strings.Builder
+	for _, s := range spans {
+		if s.FootnoteRef != "" {
+			fmt.Fprintf(&sb, "[^%s]", s.FootnoteRef)
+			continue
+		}
+		text := s.Text
+		switch {
+		case s.Code:
+			text = "`" + text + "`"
+		case s.Italic:
+			text = "_" + text + "_"
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDFRenderer renders a book as a single PDF document, built directly
+// against the PDF file format rather than pulling in a third-party PDF
+// library. Text uses the built-in Helvetica font and is wrapped using an
+// approximate average glyph width, since exact font metrics aren't
+// available without embedding a font. Images aren't embedded.
+type PDFRenderer struct {
+	w      io.Writer
+	blocks []pdfBlock
+}
+
+type pdfBlock struct {
+	text string
+	size float64
+	bold bool
+}
+
+const (
+	pdfPageW   = 595.0 // A4, in points
+	pdfPageH   = 842.0
+	pdfMargin  = 56.0
+	pdfBodySz  = 11.0
+	pdfLineGap = 4.0
+	pdfParaGap = 6.0
+)
+
+func NewPDFRenderer(w io.Writer) *PDFRenderer {
+	return &PDFRenderer{w: w}
+}
+
+func (p *PDFRenderer) BeginBook(meta MetaInfo) error {
+	p.blocks = append(p.blocks, pdfBlock{text: meta.ToTitle(), size: 20, bold: true})
+	return nil
+}
+
+func (p *PDFRenderer) BeginChapter(title string) error {
+	p.blocks = append(p.blocks, pdfBlock{text: title, size: 16, bold: true})
+	return nil
+}
+
+func (p *PDFRenderer) EmitHeading(level int, spans []Span) error {
+	size := 14.0 - float64(level)
+	if size < pdfBodySz {
+		size = pdfBodySz
+	}
+	p.blocks = append(p.blocks, pdfBlock{text: spansToPlain(spans), size: size, bold: true})
+	return nil
+}
+
+func (p *PDFRenderer) EmitParagraph(spans []Span) error {
+	p.blocks = append(p.blocks, pdfBlock{text: spansToPlain(spans), size: pdfBodySz})
+	return nil
+}
+
+func (p *PDFRenderer) EmitImage(src, alt string) error {
+	return nil
+}
+
+func (p *PDFRenderer) EmitList(list List) error {
+	p.emitListItems(list, 0)
+	return nil
+}
+
+func (p *PDFRenderer) emitListItems(list List, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i, item := range list.Items {
+		marker := "-"
+		if list.Ordered {
+			marker = fmt.Sprintf("%d.", i+1)
+		}
+		p.blocks = append(p.blocks, pdfBlock{text: indent + marker + " " + spansToPlain(item.Spans), size: pdfBodySz})
+		for _, child := range item.Children {
+			p.emitListItems(child, depth+1)
+		}
+	}
+}
+
+func (p *PDFRenderer) EmitTable(table Table) error {
+	for _, row := range table.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = spansToPlain(cell.Spans)
+		}
+		p.blocks = append(p.blocks, pdfBlock{text: strings.Join(cells, " | "), size: pdfBodySz})
+	}
+	return nil
+}
+
+func (p *PDFRenderer) EmitFootnotes(footnotes []Footnote) error {
+	p.blocks = append(p.blocks, pdfBlock{text: "Footnotes", size: 13, bold: true})
+	for _, fn := range footnotes {
+		p.blocks = append(p.blocks, pdfBlock{text: fmt.Sprintf("[%s] %s", fn.ID, spansToPlain(fn.Spans)), size: pdfBodySz})
+	}
+	return nil
+}
+
+func (p *PDFRenderer) EndChapter() error { return nil }
+
+func (p *PDFRenderer) End() error {
+	return p.write(p.layout())
+}
+
+type pdfLine struct {
+	text string
+	size float64
+	bold bool
+}
+
+// layout breaks the accumulated blocks into fixed-size pages, wrapping
+// paragraph text to fit the page width.
+func (p *PDFRenderer) layout() [][]pdfLine {
+	var pages [][]pdfLine
+	var page []pdfLine
+	y := pdfPageH - pdfMargin
+
+	newPage := func() {
+		pages = append(pages, page)
+		page = nil
+		y = pdfPageH - pdfMargin
+	}
+	addLine := func(l pdfLine, lineHeight float64) {
+		if y-lineHeight < pdfMargin {
+			newPage()
+		}
+		page = append(page, l)
+		y -= lineHeight
+	}
+
+	for _, b := range p.blocks {
+		lineHeight := b.size + pdfLineGap
+		for _, line := range wrapText(b.text, b.size, pdfPageW-2*pdfMargin) {
+			addLine(pdfLine{text: line, size: b.size, bold: b.bold}, lineHeight)
+		}
+		y -= pdfParaGap
+	}
+	if len(page) > 0 || len(pages) == 0 {
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// wrapText greedily wraps text to fit maxWidth, estimating each glyph's
+// width as half of the font size.
+func wrapText(text string, size, maxWidth float64) []string {
+	if text == "" {
+		return []string{""}
+	}
+	maxChars := int(maxWidth / (size * 0.5))
+	if maxChars < 1 {
+		maxChars = 1
+	}
+	var lines []string
+	var cur strings.Builder
+	for _, word := range strings.Fields(text) {
+		if cur.Len() > 0 && cur.Len()+1+len(word) > maxChars {
+			lines = append(lines, cur.String())
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteByte(' ')
+		}
+		cur.WriteString(word)
+	}
+	if cur.Len() > 0 {
+		lines = append(lines, cur.String())
+	}
+	return lines
+}
+
+func spansToPlain(spans []Span) string {
+	var sb strings.Builder
+	for _, s := range spans {
+		if s.FootnoteRef != "" {
+			fmt.Fprintf(&sb, "[%s]", s.FootnoteRef)
+			continue
+		}
+		sb.WriteString(s.Text)
+	}
+	return sb.String()
+}
+
+// pdfEncode best-effort transcodes s (UTF-8) to the Latin-1 byte range
+// PDF's WinAnsiEncoding expects, replacing anything outside it.
+func pdfEncode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r <= 0xFF {
+			out = append(out, byte(r))
+		} else {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+func pdfEscape(b []byte) []byte {
+	var buf bytes.Buffer
+	for _, c := range b {
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(c)
+	}
+	return buf.Bytes()
+}
+
+// write emits a minimal single-file PDF: a Catalog, a Pages tree, two
+// standard fonts, and one Page + content stream object pair per page.
+func (p *PDFRenderer) write(pages [][]pdfLine) error {
+	var buf bytes.Buffer
+	var offsets []int
+	objOffset := func() { offsets = append(offsets, buf.Len()) }
+
+	buf.WriteString("%PDF-1.4\n")
+
+	nextObj := 1
+	catalogObj := nextObj
+	nextObj++
+	pagesObj := nextObj
+	nextObj++
+	font1Obj := nextObj
+	nextObj++
+	font2Obj := nextObj
+	nextObj++
+
+	type ids struct{ page, content int }
+	pageIDs := make([]ids, len(pages))
+	for i := range pages {
+		pageIDs[i] = ids{page: nextObj, content: nextObj + 1}
+		nextObj += 2
+	}
+
+	objOffset()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", catalogObj, pagesObj)
+
+	var kids strings.Builder
+	for _, id := range pageIDs {
+		fmt.Fprintf(&kids, "%d 0 R ", id.page)
+	}
+	objOffset()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Pages /Kids [ %s] /Count %d >>\nendobj\n", pagesObj, kids.String(), len(pageIDs))
+
+	objOffset()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>\nendobj\n", font1Obj)
+
+	objOffset()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>\nendobj\n", font2Obj)
+
+	for i, lines := range pages {
+		id := pageIDs[i]
+		var content bytes.Buffer
+		content.WriteString("BT\n")
+		y := pdfPageH - pdfMargin
+		for _, l := range lines {
+			lineHeight := l.size + pdfLineGap
+			font := "F1"
+			if l.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "/%s %g Tf\n1 0 0 1 %g %g Tm\n(%s) Tj\n", font, l.size, pdfMargin, y, pdfEscape(pdfEncode(l.text)))
+			y -= lineHeight
+		}
+		content.WriteString("ET\n")
+
+		objOffset()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			id.page, pagesObj, pdfPageW, pdfPageH, font1Obj, font2Obj, id.content)
+
+		objOffset()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", id.content, content.Len(), content.String())
+	}
+
+	xrefStart := buf.Len()
+	totalObjs := nextObj
+	fmt.Fprintf(&buf, "xref\n0 %d\n", totalObjs)
+	buf.WriteString("0000000000 65535 f \n")
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", totalObjs, catalogObj, xrefStart)
+
+	_, err := p.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+// Renderer receives the extracted structure of a book -- headings,
+// paragraphs, images -- and turns it into an on-disk artifact such as a
+// Markdown file, an EPUB archive or a PDF document.
+//
+// BeginBook is called once, BeginChapter/EndChapter bracket every
+// chapter, and the Emit* methods add content to the chapter that is
+// currently open.
+type Renderer interface {
+	// BeginBook is called once all book metadata has been fetched, before
+	// any chapter is processed.
+	BeginBook(meta MetaInfo) error
+	// BeginChapter starts a new chapter with the given title.
+	BeginChapter(title string) error
+	// EmitHeading adds a heading of the given level (1 being top-level) to
+	// the currently open chapter.
+	EmitHeading(level int, spans []Span) error
+	// EmitParagraph adds a paragraph to the currently open chapter.
+	EmitParagraph(spans []Span) error
+	// EmitImage adds the image at src (its original, absolute URL) to the
+	// currently open chapter.
+	EmitImage(src, alt string) error
+	// EmitList adds a (possibly nested) ordered or unordered list to the
+	// currently open chapter.
+	EmitList(list List) error
+	// EmitTable adds a table to the currently open chapter.
+	EmitTable(table Table) error
+	// EmitFootnotes adds the chapter's collected footnote definitions.
+	// It's only called when the chapter has at least one footnote, and
+	// always after every other Emit* call for that chapter.
+	EmitFootnotes(footnotes []Footnote) error
+	// EndChapter finishes the chapter started by BeginChapter.
+	EndChapter() error
+	// End finalizes the book. No further calls are made afterwards.
+	End() error
+}
+
+// Span is a run of text together with the inline styling it should be
+// rendered with. If FootnoteRef is non-empty, the span is a reference to
+// the footnote with that ID rather than ordinary text.
+type Span struct {
+	Text        string
+	Italic      bool
+	Code        bool
+	FootnoteRef string
+}
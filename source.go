@@ -0,0 +1,56 @@
+package main
+
+import (
+	gq "github.com/PuerkitoBio/goquery"
+)
+
+// Chapter is one chapter found on a book's index page: its URL together
+// with the title it should be rendered under.
+type Chapter struct {
+	URL   string
+	Title string
+}
+
+// FetchDoc fetches and parses the page at url. Sources that must crawl
+// beyond the index page itself (e.g. to follow pagination links) use it
+// to do so.
+type FetchDoc func(url string) (*gq.Document, error)
+
+// Source knows how to work with one particular public-domain text
+// archive: validating and normalizing a book URL, finding its chapter
+// links and metadata, and slicing the actual textual content out of a
+// chapter page.
+type Source interface {
+	// Matches reports whether rawurl points at a book hosted by this
+	// source.
+	Matches(rawurl string) bool
+	// BaseURL validates and normalizes rawurl into the book's canonical
+	// index URL.
+	BaseURL(rawurl string) (string, error)
+	// Chapters returns the chapters listed on the book's index page, in
+	// reading order. fetch is used by sources whose index page doesn't
+	// list every chapter up front, to follow links to the rest.
+	Chapters(baseUrl string, doc *gq.Document, fetch FetchDoc) ([]Chapter, error)
+	// Meta extracts book metadata from the index page.
+	Meta(doc *gq.Document) MetaInfo
+	// ExtractContent slices the actual chapter content out of a chapter
+	// page, discarding site chrome such as navigation links.
+	ExtractContent(doc *gq.Document) (*gq.Selection, error)
+}
+
+// sources lists the Source implementations to dispatch book URLs to, in
+// order of preference.
+var sources = []Source{
+	GutenbergDESource{},
+	ZenoSource{},
+}
+
+// SourceFor returns the Source that claims to handle rawurl.
+func SourceFor(rawurl string) (Source, error) {
+	for _, s := range sources {
+		if s.Matches(rawurl) {
+			return s, nil
+		}
+	}
+	return nil, ErrInvalidURL
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	gq "github.com/PuerkitoBio/goquery"
+)
+
+// ZenoSource handles texts hosted on zeno.org, the other big German
+// public-domain archive. Its pages don't split a book into an index
+// plus numbered chapter pages the way projekt-gutenberg.org does --
+// every URL is both a navigable page and (if it carries body text) a
+// chapter in its own right, with "previous"/"next" links chaining pages
+// of the same work together.
+type ZenoSource struct{}
+
+func (ZenoSource) Matches(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	return u.Host == "zeno.org" || u.Host == "www.zeno.org"
+}
+
+func (ZenoSource) BaseURL(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if !(u.Scheme == "http" || u.Scheme == "https") {
+		return "", ErrInvalidURL
+	}
+	if !(u.Host == "zeno.org" || u.Host == "www.zeno.org") {
+		return "", ErrInvalidURL
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return "", ErrInvalidURL
+	}
+	return u.Scheme + "://www.zeno.org" + u.Path, nil
+}
+
+// maxZenoPages bounds how many pages Chapters will follow the "next page"
+// chain for, as a backstop against a cyclic or pathologically long chain.
+const maxZenoPages = 2000
+
+// Chapters follows the "nächste Seite" (next page) links starting at
+// baseUrl, since zeno.org doesn't provide a separate chapter index page.
+func (ZenoSource) Chapters(baseUrl string, doc *gq.Document, fetch FetchDoc) ([]Chapter, error) {
+	var chapters []Chapter
+	visited := map[string]bool{}
+	pageUrl := baseUrl
+	for {
+		if visited[pageUrl] {
+			clearLine()
+			printWarn("Zeno next-page chain revisits %v, stopping", pageUrl)
+			return chapters, nil
+		}
+		visited[pageUrl] = true
+		chapters = append(chapters, Chapter{URL: pageUrl, Title: zenoPageTitle(doc)})
+		if len(chapters) >= maxZenoPages {
+			clearLine()
+			printWarn("Zeno next-page chain exceeds %d pages, stopping", maxZenoPages)
+			return chapters, nil
+		}
+		href, ok := doc.Find(`a[rel="next"], a.zenoNext`).First().Attr("href")
+		if !ok || href == "" {
+			return chapters, nil
+		}
+		nextUrl, err := resolveZenoRef(pageUrl, href)
+		if err != nil {
+			return nil, err
+		}
+		nextDoc, err := fetch(nextUrl)
+		if err != nil {
+			return nil, err
+		}
+		pageUrl, doc = nextUrl, nextDoc
+	}
+}
+
+// resolveZenoRef resolves href, which may be relative, against pageUrl.
+func resolveZenoRef(pageUrl, href string) (string, error) {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// zenoPageTitle titles a page after the first heading in its rendered
+// content, falling back to the page's <title> tag if it has none.
+func zenoPageTitle(doc *gq.Document) string {
+	if content, err := (ZenoSource{}).ExtractContent(doc); err == nil {
+		// Search from the content's parent so headings that are direct
+		// children of the content are found too.
+		if h := content.Parent().Find("h1, h2, h3, h4, h5, h6").First(); h.Length() > 0 {
+			return collapseSpaces(strings.TrimSpace(h.Text()))
+		}
+	}
+	return strings.TrimSpace(doc.Find("title").First().Text())
+}
+
+func (ZenoSource) Meta(doc *gq.Document) MetaInfo {
+	title := doc.Find("title").First().Text()
+	author := "Unknown"
+	year := "Unknown"
+	// zeno.org breadcrumbs are of the form "Zeno.org - Autor - Werk", so
+	// the author can usually be pulled out of it.
+	if parts := strings.Split(title, " - "); len(parts) >= 2 {
+		author = strings.TrimSpace(parts[len(parts)-2])
+		title = strings.TrimSpace(parts[len(parts)-1])
+	}
+	return MetaInfo{
+		Author: author,
+		Title:  strings.TrimSpace(title),
+		Year:   year,
+	}
+}
+
+// ExtractContent returns the page's rendered text body, which zeno.org
+// places inside a div with id "zenoOutput".
+func (ZenoSource) ExtractContent(doc *gq.Document) (*gq.Selection, error) {
+	content := doc.Find("#zenoOutput")
+	if content.Length() == 0 {
+		return nil, ErrParsingPage
+	}
+	return content.Children(), nil
+}